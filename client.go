@@ -6,4 +6,9 @@ type client interface {
 	Count(name string, value int64, tags []string, rate float64) error
 	// Gauge tracks a value at a particular points in time.
 	Gauge(name string, value float64, tags []string, rate float64) error
+	// Histogram tracks the statistical distribution of a set of values.
+	Histogram(name string, value float64, tags []string, rate float64) error
+	// Distribution tracks the statistical distribution of a set of values
+	// across your infrastructure.
+	Distribution(name string, value float64, tags []string, rate float64) error
 }
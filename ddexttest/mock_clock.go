@@ -0,0 +1,81 @@
+// Package ddexttest provides test doubles for github.com/bilus/ddext,
+// letting tests drive its internal flush cadence deterministically instead
+// of relying on time.Sleep.
+package ddexttest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bilus/ddext/internal/clockext"
+)
+
+// MockClock is a clockext.Clock that only moves forward when Advance is
+// called, letting tests assert flush behavior without sleeping.
+type MockClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*mockTicker
+}
+
+// NewMockClock returns a MockClock starting at now.
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now implements clockext.Clock.
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker implements clockext.Clock, returning a ticker that only fires
+// when Advance moves the clock past its interval.
+func (c *MockClock) NewTicker(d time.Duration) clockext.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &mockTicker{last: c.now, interval: d, ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every ticker created via
+// NewTicker whose interval has elapsed since its last tick.
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		t.advance(c.now)
+	}
+}
+
+type mockTicker struct {
+	interval time.Duration
+	last     time.Time
+	ch       chan time.Time
+	stopped  bool
+}
+
+func (t *mockTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *mockTicker) Stop() {
+	t.stopped = true
+}
+
+// advance is called with the owning MockClock's lock held.
+func (t *mockTicker) advance(now time.Time) {
+	if t.stopped {
+		return
+	}
+	for now.Sub(t.last) >= t.interval {
+		t.last = t.last.Add(t.interval)
+		select {
+		case t.ch <- t.last:
+		default:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package httpext provides an http.Handler middleware emitting
+// request-level Datadog RED (rate, errors, duration) metrics, mirroring
+// what github.com/bilus/ddext does at the net.Listener level.
+package httpext
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	requestCountMetricFmt    = "%s.request_count"
+	requestDurationMetricFmt = "%s.request_duration"
+	inFlightMetricFmt        = "%s.in_flight_requests"
+	requestBytesMetricFmt    = "%s.request_bytes"
+	responseBytesMetricFmt   = "%s.response_bytes"
+
+	defaultPrefix     = "http"
+	defaultSampleRate = 1
+)
+
+// MiddlewareOptions includes additional middleware configuration options.
+type MiddlewareOptions struct {
+	// MetricPrefix is added to every metric (AFTER conrad.).
+	MetricPrefix string // default: http
+	// RoutePattern, when set, is called for every request to derive a
+	// `route` tag value (e.g. "/users/:id" instead of "/users/42"),
+	// avoiding high-cardinality tags. Requests for which it returns "" are
+	// left without a route tag.
+	RoutePattern func(r *http.Request) string
+	// SampleRate is passed through to every Datadog call. default: 1
+	SampleRate float64
+}
+
+// Middleware wraps next, emitting Datadog metrics for every request: a
+// request count tagged by method and status_code bucket (and, optionally,
+// route), a distribution of request duration, a gauge of in-flight
+// requests, and counters of request/response body bytes. Hijacked requests
+// (e.g. websocket upgrades) only update the in-flight gauge. Only the first
+// opts argument is used, if any.
+func Middleware(next http.Handler, c client, opts ...MiddlewareOptions) http.Handler {
+	var opt MiddlewareOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.MetricPrefix == "" {
+		opt.MetricPrefix = defaultPrefix
+	}
+	if opt.SampleRate == 0 {
+		opt.SampleRate = defaultSampleRate
+	}
+
+	requestCountMetricName := fmt.Sprintf(requestCountMetricFmt, opt.MetricPrefix)
+	requestDurationMetricName := fmt.Sprintf(requestDurationMetricFmt, opt.MetricPrefix)
+	inFlightMetricName := fmt.Sprintf(inFlightMetricFmt, opt.MetricPrefix)
+	requestBytesMetricName := fmt.Sprintf(requestBytesMetricFmt, opt.MetricPrefix)
+	responseBytesMetricName := fmt.Sprintf(responseBytesMetricFmt, opt.MetricPrefix)
+
+	var inFlight atomic.Uint32
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		c.Gauge(inFlightMetricName, float64(inFlight.Add(1)), nil, opt.SampleRate)
+		defer func() {
+			c.Gauge(inFlightMetricName, float64(inFlight.Add(^uint32(0))), nil, opt.SampleRate)
+		}()
+
+		cb := &countingBody{ReadCloser: r.Body}
+		r.Body = cb
+
+		sw := NewResponseWriter(w)
+		next.ServeHTTP(sw, r)
+
+		// A hijacked connection (e.g. a websocket upgrade) is no longer
+		// driven by this handler, so the usual response metrics don't apply.
+		if sw.Hijacked() {
+			return
+		}
+
+		tags := []string{
+			fmt.Sprintf("method:%s", r.Method),
+			fmt.Sprintf("status_code:%s", statusCodeBucket(sw.StatusCode())),
+		}
+		if opt.RoutePattern != nil {
+			if route := opt.RoutePattern(r); route != "" {
+				tags = append(tags, fmt.Sprintf("route:%s", route))
+			}
+		}
+
+		c.Count(requestCountMetricName, 1, tags, opt.SampleRate)
+		c.Distribution(requestDurationMetricName, time.Since(start).Seconds(), tags, opt.SampleRate)
+		if n := cb.bytes; n > 0 {
+			c.Count(requestBytesMetricName, n, tags, opt.SampleRate)
+		}
+		if n := sw.BytesWritten(); n > 0 {
+			c.Count(responseBytesMetricName, int64(n), tags, opt.SampleRate)
+		}
+	})
+}
+
+// statusCodeBucket maps an HTTP status code to its class, e.g. 404 -> "4xx".
+func statusCodeBucket(status int) string {
+	switch {
+	case status >= 100 && status < 200:
+		return "1xx"
+	case status >= 200 && status < 300:
+		return "2xx"
+	case status >= 300 && status < 400:
+		return "3xx"
+	case status >= 400 && status < 500:
+		return "4xx"
+	case status >= 500 && status < 600:
+		return "5xx"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,127 @@
+package httpext_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bilus/ddext/httpext"
+	"github.com/stretchr/testify/require"
+)
+
+type metric struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+type mockClient struct {
+	mu      sync.Mutex
+	counts  []metric
+	gauges  []metric
+	distrib []metric
+}
+
+func (c *mockClient) Count(name string, value int64, tags []string, rate float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = append(c.counts, metric{name, float64(value), tags})
+	return nil
+}
+
+func (c *mockClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gauges = append(c.gauges, metric{name, value, tags})
+	return nil
+}
+
+func (c *mockClient) Distribution(name string, value float64, tags []string, rate float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.distrib = append(c.distrib, metric{name, value, tags})
+	return nil
+}
+
+func TestMiddleware_RequestCountAndStatusBucket(t *testing.T) {
+	require := require.New(t)
+
+	c := &mockClient{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	})
+
+	handler := httpext.Middleware(next, c)
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(http.StatusNotFound, rec.Code)
+	require.Len(c.counts, 2) // request_count + response_bytes
+	require.Equal("http.request_count", c.counts[0].name)
+	require.Contains(c.counts[0].tags, "method:GET")
+	require.Contains(c.counts[0].tags, "status_code:4xx")
+	require.Len(c.distrib, 1)
+	require.Equal("http.request_duration", c.distrib[0].name)
+}
+
+func TestMiddleware_RoutePattern(t *testing.T) {
+	require := require.New(t)
+
+	c := &mockClient{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	opts := httpext.MiddlewareOptions{
+		RoutePattern: func(r *http.Request) string { return "/users/:id" },
+	}
+	handler := httpext.Middleware(next, c, opts)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Contains(c.counts[0].tags, "route:/users/:id")
+}
+
+func TestMiddleware_RequestBytes_UnknownContentLength(t *testing.T) {
+	require := require.New(t)
+
+	c := &mockClient{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	})
+	handler := httpext.Middleware(next, c)
+
+	req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader("hello world")))
+	req.ContentLength = -1 // Unknown length, e.g. chunked transfer encoding.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var requestBytes float64
+	for _, m := range c.counts {
+		if m.name == "http.request_bytes" {
+			requestBytes = m.value
+		}
+	}
+	require.Equal(11.0, requestBytes)
+}
+
+func TestMiddleware_InFlightGauge(t *testing.T) {
+	require := require.New(t)
+
+	c := &mockClient{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := httpext.Middleware(next, c)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Len(c.gauges, 2)
+	require.Equal(1.0, c.gauges[0].value)
+	require.Equal(0.0, c.gauges[1].value)
+}
@@ -0,0 +1,20 @@
+package httpext
+
+import "io"
+
+// countingBody wraps an http.Request's Body, counting the number of bytes
+// actually read by the handler. This covers chunked-encoding and other
+// unknown-length request bodies, for which r.ContentLength is -1 or 0 even
+// though the handler reads a non-empty body.
+type countingBody struct {
+	io.ReadCloser
+
+	bytes int64
+}
+
+// Read implements io.Reader, recording the number of bytes read.
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,90 @@
+package httpext
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps http.ResponseWriter, capturing the status code and
+// number of bytes written so the middleware can report accurate metrics. It
+// forwards Hijack and Flush to the underlying writer when supported, so
+// hijacked connections (e.g. websocket upgrades) and streaming responses
+// keep working unchanged.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	status      int
+	bytes       int
+	wroteHeader bool
+	hijacked    bool
+}
+
+// NewResponseWriter returns a ResponseWriter wrapping w.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// WriteHeader implements http.ResponseWriter, recording the status code.
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter, recording the number of bytes
+// written.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter supports
+// it, so the middleware doesn't break websocket upgrades.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("httpext: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter supports
+// it, so streaming responses keep flushing as expected.
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// StatusCode returns the response status code, defaulting to 200 if the
+// handler never called WriteHeader (mirroring net/http's own behaviour).
+func (w *ResponseWriter) StatusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// BytesWritten returns the number of response body bytes written so far.
+func (w *ResponseWriter) BytesWritten() int {
+	return w.bytes
+}
+
+// Hijacked reports whether the connection has been hijacked, e.g. for a
+// websocket upgrade.
+func (w *ResponseWriter) Hijacked() bool {
+	return w.hijacked
+}
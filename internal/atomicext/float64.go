@@ -0,0 +1,30 @@
+package atomicext
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Float64 is an atomic float64, built on top of sync/atomic.Uint64 since the
+// standard library doesn't provide one (unlike go.uber.org/atomic). This is
+// the same bit-reinterpretation trick used by syncthing and
+// nextcloud-spreed-signaling when they migrated off go.uber.org/atomic.
+type Float64 struct {
+	bits atomic.Uint64
+}
+
+// Load returns the current value.
+func (f *Float64) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Store sets the value unconditionally.
+func (f *Float64) Store(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+// CompareAndSwap replaces value only if it's still equal to old, returning
+// whether the swap happened.
+func (f *Float64) CompareAndSwap(old, new float64) bool {
+	return f.bits.CompareAndSwap(math.Float64bits(old), math.Float64bits(new))
+}
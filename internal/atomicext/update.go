@@ -13,20 +13,28 @@ type Atomic[T any] interface {
 	CompareAndSwap(old T, new T) bool
 }
 
-func Update[T Number](a Atomic[T], retries int, f func(old T) T) error {
-	// Store max gauge value, retrying if another thread modified it.
+// Update atomically replaces a's value with f(old), retrying when a
+// concurrent writer wins the race and returning an error once retries
+// CompareAndSwap attempts have failed. shouldReplace decides
+// whether f(old) actually replaces old; pass nil to keep the default
+// "replace if greater" (max) policy. If f(old) should not replace old,
+// Update returns immediately without touching a.
+func Update[T Number](a Atomic[T], retries int, f func(old T) T, shouldReplace func(old, new T) bool) error {
+	if shouldReplace == nil {
+		shouldReplace = func(old, new T) bool { return new > old }
+	}
 	for {
 		old := a.Load()
 		value := f(old)
-		if old < value {
-			if a.CompareAndSwap(old, value) {
-				return nil
-			}
-			retries--
-			if retries == 0 {
-				return errors.New("Timed out trying to update an atomic value")
-			}
+		if !shouldReplace(old, value) {
+			return nil
+		}
+		if a.CompareAndSwap(old, value) {
+			return nil
+		}
+		retries--
+		if retries == 0 {
+			return errors.New("timed out trying to update an atomic value")
 		}
-		return nil
 	}
 }
@@ -0,0 +1,70 @@
+package atomicext_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bilus/ddext/internal/atomicext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_MaxUnderContention(t *testing.T) {
+	require := require.New(t)
+
+	var max atomic.Uint32
+
+	var wg sync.WaitGroup
+	for i := uint32(1); i <= 100; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := atomicext.Update[uint32](&max, 1000, func(old uint32) uint32 {
+				if i > old {
+					return i
+				}
+				return old
+			}, nil)
+			require.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(uint32(100), max.Load())
+}
+
+func TestUpdate_NoUpdateNeeded(t *testing.T) {
+	require := require.New(t)
+
+	var v atomic.Uint32
+	v.Store(10)
+
+	err := atomicext.Update[uint32](&v, 1, func(old uint32) uint32 {
+		return old - 1 // Lower than old: shouldn't replace (default max policy).
+	}, nil)
+	require.NoError(err)
+	require.Equal(uint32(10), v.Load())
+}
+
+func TestUpdate_CustomShouldReplace(t *testing.T) {
+	require := require.New(t)
+
+	var v atomic.Uint32
+	v.Store(10)
+
+	// A "min" policy via a custom shouldReplace.
+	min := func(old, new uint32) bool { return new < old }
+
+	err := atomicext.Update[uint32](&v, 1, func(old uint32) uint32 {
+		return old - 1
+	}, min)
+	require.NoError(err)
+	require.Equal(uint32(9), v.Load())
+
+	err = atomicext.Update[uint32](&v, 1, func(old uint32) uint32 {
+		return old + 1
+	}, min)
+	require.NoError(err)
+	require.Equal(uint32(9), v.Load()) // Unchanged: 10 is not < 9.
+}
@@ -0,0 +1,41 @@
+// Package clockext abstracts time.Now and time.NewTicker behind an
+// interface so code depending on them, like listener.run's flush cadence,
+// can be driven deterministically in tests.
+package clockext
+
+import "time"
+
+// Ticker abstracts *time.Ticker.
+type Ticker interface {
+	// C returns the channel on which ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// Clock abstracts time.Now and time.NewTicker.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Real is a Clock backed by the real wall clock and time.NewTicker.
+type Real struct{}
+
+// Now implements Clock.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker implements Clock.
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
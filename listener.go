@@ -6,50 +6,137 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bilus/ddext/internal/atomicext"
-	"go.uber.org/atomic"
+	"github.com/bilus/ddext/internal/clockext"
 )
 
 // listener emits metrics related to accepted connections.
 type listener struct {
 	net.Listener
 
-	gaugeMetricName string // the GAUGE metric name
-	countMetricName string // the COUNTER metric name
+	gaugeMetricName        string // the GAUGE metric name
+	countMetricName        string // the COUNTER metric name
+	durationMetricName     string // the connection duration DISTRIBUTION metric name
+	bytesReadMetricName    string // the bytes read COUNTER metric name
+	bytesWrittenMetricName string // the bytes written COUNTER metric name
+	atCapacityMetricName   string // the at-capacity GAUGE metric name
+
+	tags       []string // tags added to every metric
+	sampleRate float64  // sample rate passed to every Datadog call
+
+	maxOpenConnections int             // 0 means no limit
+	onOverLimit        OverLimitPolicy // what Accept does once maxOpenConnections is reached
+
+	clock clockext.Clock
 
 	client client
 
-	accepted *atomic.Uint32 // accepted connection count
-	timedout *atomic.Uint32 // timedout connection count
-	errored  *atomic.Uint32 // errored connection count
+	accepted atomic.Uint32 // accepted connection count
+	timedout atomic.Uint32 // timedout connection count
+	errored  atomic.Uint32 // errored connection count
+	rejected atomic.Uint32 // rejected (over limit) connection count
 
 	// open tracks the current number of open connections
 	// and is used to calculate maxPeriodOpen (see below).
-	open *atomic.Uint32 // current open connection count
+	open atomic.Uint32 // current open connection count
 
 	// maxPeriodOpen tracks the maximum number of open connections between
 	// subsequent flushes because using `open` directly would only sample the
 	// value once every flush interval which is 10 second by default,
 	// effectively ignoring lots of peak values.
-	maxPeriodOpen *atomic.Uint32 // max open connections since the last flush
-	exit          chan struct{}  // exit signal channel (on Close call)
+	maxPeriodOpen atomic.Uint32 // max open connections since the last flush
+	exit          chan struct{} // exit signal channel (on Close call), single-use handoff with run()
+
+	// closing is closed by Close and never sent on, so any number of
+	// goroutines (e.g. Accept calls blocked under the Block policy) can
+	// observe it without racing run() for exit's one-shot handoff.
+	closing     chan struct{}
+	closingOnce sync.Once
 }
 
 const (
-	gaugeMetricFmt       = "%s.open_connections"
-	countMetricFmt       = "%s.accept"
-	defaultPrefix        = "http"
-	defaultFlushInterval = 10 * time.Second
+	gaugeMetricFmt        = "%s.open_connections"
+	countMetricFmt        = "%s.accept"
+	durationMetricFmt     = "%s.connection_duration"
+	bytesReadMetricFmt    = "%s.bytes_read"
+	bytesWrittenMetricFmt = "%s.bytes_written"
+	atCapacityMetricFmt   = "%s.at_capacity"
+	defaultPrefix         = "http"
+	defaultFlushInterval  = 10 * time.Second
+	defaultSampleRate     = 1
+
+	// blockPollInterval is how often Accept rechecks capacity while blocked
+	// under the Block over-limit policy.
+	blockPollInterval = 10 * time.Millisecond
+)
+
+// Tag values used on the accept counter's status tag, exported so callers
+// can filter on them consistently in Datadog.
+const (
+	TagStatusSuccess  = "status:success"
+	TagStatusTimeout  = "status:timeout"
+	TagStatusError    = "status:error"
+	TagStatusRejected = "status:rejected"
 )
 
+// OverLimitPolicy decides what a listener's Accept does once
+// MaxOpenConnections is reached.
+type OverLimitPolicy int
+
+const (
+	// Reject makes Accept immediately return ErrAtCapacity without
+	// accepting the pending connection. It's the default policy.
+	Reject OverLimitPolicy = iota
+	// Block makes Accept wait until an existing connection closes and
+	// capacity frees up.
+	Block
+	// Close makes Accept accept the pending connection and immediately
+	// close it, so the client sees a clean disconnect rather than a
+	// timeout.
+	Close
+)
+
+// ErrAtCapacity is returned by Accept when MaxOpenConnections is reached and
+// OnOverLimit is Reject or Close.
+var ErrAtCapacity net.Error = overLimitError{}
+
+type overLimitError struct{}
+
+func (overLimitError) Error() string   { return "ddext: listener is at capacity" }
+func (overLimitError) Timeout() bool   { return false }
+func (overLimitError) Temporary() bool { return true }
+
 // ListenerOptions includes additional listener configuration options.
 type ListenerOptions struct {
 	// FlushInterval determines how often metrics are sent to Datadog.
 	FlushInterval time.Duration // default: 10s
 	// MetricPrefix is added to every metric (AFTER conrad.).
 	MetricPrefix string // default: http
+	// Tags are merged into every Count/Gauge call the listener makes, in
+	// addition to the accept counter's status tag.
+	Tags []string
+	// GaugeMetricName overrides the open-connections GAUGE metric name,
+	// bypassing MetricPrefix.
+	GaugeMetricName string
+	// CountMetricName overrides the accept COUNTER metric name, bypassing
+	// MetricPrefix.
+	CountMetricName string
+	// SampleRate is passed through to every Datadog call made by the
+	// listener. default: 1
+	SampleRate float64
+	// MaxOpenConnections caps the number of concurrently open connections.
+	// When unset (zero), the listener places no limit on open connections.
+	MaxOpenConnections int
+	// OnOverLimit decides what Accept does once MaxOpenConnections is
+	// reached. default: Reject
+	OnOverLimit OverLimitPolicy
+	// Clock is the time source used for the flush cadence and connection
+	// duration measurements. default: the real wall clock
+	Clock clockext.Clock
 }
 
 // ErrOptsArgumentError indicates more than 1 opts argument was passed.
@@ -71,30 +158,55 @@ func NewListener(ln net.Listener, client client, opts ...ListenerOptions) (net.L
 	if opt.MetricPrefix == "" {
 		opt.MetricPrefix = defaultPrefix
 	}
+	if opt.SampleRate == 0 {
+		opt.SampleRate = defaultSampleRate
+	}
+	if opt.Clock == nil {
+		opt.Clock = clockext.Real{}
+	}
+	gaugeMetricName := opt.GaugeMetricName
+	if gaugeMetricName == "" {
+		gaugeMetricName = fmt.Sprintf(gaugeMetricFmt, opt.MetricPrefix)
+	}
+	countMetricName := opt.CountMetricName
+	if countMetricName == "" {
+		countMetricName = fmt.Sprintf(countMetricFmt, opt.MetricPrefix)
+	}
 	ccl := &listener{
-		Listener:        ln,
-		client:          client,
-		gaugeMetricName: fmt.Sprintf(gaugeMetricFmt, opt.MetricPrefix),
-		countMetricName: fmt.Sprintf(countMetricFmt, opt.MetricPrefix),
-
-		accepted:      atomic.NewUint32(0),
-		timedout:      atomic.NewUint32(0),
-		errored:       atomic.NewUint32(0),
-		open:          atomic.NewUint32(0),
-		maxPeriodOpen: atomic.NewUint32(0),
-		exit:          make(chan struct{}),
-	}
-	go ccl.run(opt.FlushInterval)
+		Listener:               ln,
+		client:                 client,
+		gaugeMetricName:        gaugeMetricName,
+		countMetricName:        countMetricName,
+		durationMetricName:     fmt.Sprintf(durationMetricFmt, opt.MetricPrefix),
+		bytesReadMetricName:    fmt.Sprintf(bytesReadMetricFmt, opt.MetricPrefix),
+		bytesWrittenMetricName: fmt.Sprintf(bytesWrittenMetricFmt, opt.MetricPrefix),
+		atCapacityMetricName:   fmt.Sprintf(atCapacityMetricFmt, opt.MetricPrefix),
+
+		tags:       opt.Tags,
+		sampleRate: opt.SampleRate,
+
+		maxOpenConnections: opt.MaxOpenConnections,
+		onOverLimit:        opt.OnOverLimit,
+
+		clock: opt.Clock,
+
+		exit:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	// Created synchronously (rather than inside the run goroutine below) so
+	// that, by the time NewListener returns, a test using a MockClock can
+	// call Advance and be sure the ticker is already registered.
+	tick := opt.Clock.NewTicker(opt.FlushInterval)
+	go ccl.run(tick)
 	return ccl, nil
 }
 
-func (ln *listener) run(flushInterval time.Duration) {
-	tick := time.NewTicker(flushInterval)
+func (ln *listener) run(tick clockext.Ticker) {
 	defer tick.Stop()
 	defer close(ln.exit)
 	for {
 		select {
-		case <-tick.C:
+		case <-tick.C():
 			ln.flushMetrics()
 		case <-ln.exit:
 			return
@@ -104,38 +216,96 @@ func (ln *listener) run(flushInterval time.Duration) {
 
 func (ln *listener) flushMetrics() {
 	v := ln.maxPeriodOpen.Swap(0)
-	ln.client.Gauge(ln.gaugeMetricName, float64(v), nil, 1)
+	ln.client.Gauge(ln.gaugeMetricName, float64(v), ln.tags, ln.sampleRate)
+
+	if ln.maxOpenConnections > 0 {
+		atCapacity := 0.0
+		if ln.open.Load() >= uint32(ln.maxOpenConnections) {
+			atCapacity = 1.0
+		}
+		ln.client.Gauge(ln.atCapacityMetricName, atCapacity, ln.tags, ln.sampleRate)
+	}
 
 	for tag, stat := range map[string]*atomic.Uint32{
-		"status:success": ln.accepted,
-		"status:timeout": ln.timedout,
-		"status:error":   ln.errored,
+		TagStatusSuccess:  &ln.accepted,
+		TagStatusTimeout:  &ln.timedout,
+		TagStatusError:    &ln.errored,
+		TagStatusRejected: &ln.rejected,
 	} {
 		if v := int64(stat.Swap(0)); v > 0 {
-			ln.client.Count(ln.countMetricName, v, []string{tag}, 1)
+			ln.client.Count(ln.countMetricName, v, append(append([]string{}, ln.tags...), tag), ln.sampleRate)
 		}
 	}
 }
 
-// Accept implements net.Listener and keeps count of open connections.
+// Accept implements net.Listener and keeps count of open connections. If
+// MaxOpenConnections is set and reached, it applies OnOverLimit.
 func (ln *listener) Accept() (net.Conn, error) {
+	for ln.atCapacity() {
+		switch ln.onOverLimit {
+		case Block:
+			select {
+			case <-time.After(blockPollInterval):
+				continue
+			case <-ln.closing:
+				return nil, net.ErrClosed
+			}
+		case Close:
+			conn, err := ln.Listener.Accept()
+			if err != nil {
+				return conn, ln.recordAcceptError(err)
+			}
+			ln.rejected.Add(1)
+			conn.Close()
+			return nil, ErrAtCapacity
+		default: // Reject
+			ln.rejected.Add(1)
+			return nil, ErrAtCapacity
+		}
+	}
+
 	conn, err := ln.Listener.Accept()
 	if err != nil {
-		if ne, ok := err.(net.Error); ok && ne.Timeout() && !ne.Temporary() {
-			ln.timedout.Inc()
-		} else {
-			ln.errored.Inc()
-		}
-		return conn, err
+		return conn, ln.recordAcceptError(err)
 	}
-	new := ln.accepted.Inc()
-	atomicext.Update[uint32](ln.maxPeriodOpen, 100, func(old uint32) uint32 {
+	ln.accepted.Add(1)
+	new := ln.open.Add(1)
+	atomicext.Update[uint32](&ln.maxPeriodOpen, 100, func(old uint32) uint32 {
 		if new > old {
 			return new
 		}
 		return old
-	})
-	return decOnCloseConn{conn, ln.open}, nil
+	}, nil)
+	return &decOnCloseConn{
+		Conn:       conn,
+		open:       &ln.open,
+		client:     ln.client,
+		clock:      ln.clock,
+		acceptedAt: ln.clock.Now(),
+
+		tags:       ln.tags,
+		sampleRate: ln.sampleRate,
+
+		durationMetricName:     ln.durationMetricName,
+		bytesReadMetricName:    ln.bytesReadMetricName,
+		bytesWrittenMetricName: ln.bytesWrittenMetricName,
+	}, nil
+}
+
+// atCapacity reports whether MaxOpenConnections is set and reached.
+func (ln *listener) atCapacity() bool {
+	return ln.maxOpenConnections > 0 && ln.open.Load() >= uint32(ln.maxOpenConnections)
+}
+
+// recordAcceptError classifies an error from the underlying Accept and
+// returns it unchanged.
+func (ln *listener) recordAcceptError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && !ne.Temporary() {
+		ln.timedout.Add(1)
+	} else {
+		ln.errored.Add(1)
+	}
+	return err
 }
 
 func (ln *listener) updatePeriodOpen(value uint32) {
@@ -161,20 +331,66 @@ func (ln *listener) Close() error {
 	err := ln.Listener.Close()
 	ln.flushMetrics()
 
+	ln.closingOnce.Do(func() { close(ln.closing) })
+
 	ln.exit <- struct{}{}
 	<-ln.exit
 	return err
 }
 
-// decOnCloseConn decreases active connection count when the connection closes.
+// decOnCloseConn decreases active connection count when the connection
+// closes and reports per-connection lifetime metrics: connection duration
+// and bytes read/written.
 type decOnCloseConn struct {
 	net.Conn
 
 	open *atomic.Uint32 // open connection count
+
+	client     client
+	clock      clockext.Clock
+	acceptedAt time.Time
+
+	tags       []string
+	sampleRate float64
+
+	durationMetricName     string
+	bytesReadMetricName    string
+	bytesWrittenMetricName string
+
+	bytesRead    atomic.Uint64
+	bytesWritten atomic.Uint64
+}
+
+// Read implements net.Conn, tracking the number of bytes read.
+func (conn *decOnCloseConn) Read(b []byte) (int, error) {
+	n, err := conn.Conn.Read(b)
+	if n > 0 {
+		conn.bytesRead.Add(uint64(n))
+	}
+	return n, err
 }
 
-// Close implements net.Conn, decreasing the number of open connections.
-func (conn decOnCloseConn) Close() error {
-	conn.open.Dec()
+// Write implements net.Conn, tracking the number of bytes written.
+func (conn *decOnCloseConn) Write(b []byte) (int, error) {
+	n, err := conn.Conn.Write(b)
+	if n > 0 {
+		conn.bytesWritten.Add(uint64(n))
+	}
+	return n, err
+}
+
+// Close implements net.Conn, decreasing the number of open connections and
+// emitting the connection's lifetime metrics.
+func (conn *decOnCloseConn) Close() error {
+	conn.open.Add(^uint32(0)) // Decrement (see sync/atomic.Uint32.Add docs).
+
+	conn.client.Distribution(conn.durationMetricName, conn.clock.Now().Sub(conn.acceptedAt).Seconds(), conn.tags, conn.sampleRate)
+	if v := conn.bytesRead.Load(); v > 0 {
+		conn.client.Count(conn.bytesReadMetricName, int64(v), conn.tags, conn.sampleRate)
+	}
+	if v := conn.bytesWritten.Load(); v > 0 {
+		conn.client.Count(conn.bytesWrittenMetricName, int64(v), conn.tags, conn.sampleRate)
+	}
+
 	return conn.Conn.Close()
 }
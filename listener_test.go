@@ -3,13 +3,15 @@ package ddext_test
 import (
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/bilus/ddext"
+	"github.com/bilus/ddext/ddexttest"
 	"github.com/bilus/ddext/internal/atomicext"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/atomic"
 )
 
 type noopListener struct{}
@@ -72,14 +74,14 @@ func (noopAddr) String() string {
 
 type mockClient struct {
 	countSum *atomic.Int64
-	gaugeMax *atomic.Float64
+	gaugeMax *atomicext.Float64
 	t        *testing.T
 }
 
 func newMockClient(t *testing.T) mockClient {
 	return mockClient{
-		countSum: atomic.NewInt64(0),
-		gaugeMax: atomic.NewFloat64(0),
+		countSum: new(atomic.Int64),
+		gaugeMax: new(atomicext.Float64),
 		t:        t,
 	}
 }
@@ -102,20 +104,30 @@ func (c mockClient) Gauge(name string, value float64, tags []string, rate float6
 			return value
 		}
 		return old
-	})
+	}, nil)
 	if err != nil {
 		c.t.Fatalf("Error in mockClient.Gauge: %v", err)
 	}
 	return nil
 }
 
+func (c mockClient) Histogram(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c mockClient) Distribution(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
 func TestListener(t *testing.T) {
 	require := require.New(t)
 
 	c := newMockClient(t)
-	listener, _ := ddext.NewListener(noopListener{}, c,
-		// Only listener.Close flushes so countSum can accummulate.
-		ddext.ListenerOptions{FlushInterval: 10 * time.Millisecond})
+	clock := ddexttest.NewMockClock(time.Unix(0, 0))
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval: 10 * time.Millisecond,
+		Clock:         clock,
+	})
 
 	conns := make([]net.Conn, 10)
 	for j := 0; j < 10; j++ {
@@ -123,8 +135,10 @@ func TestListener(t *testing.T) {
 		conns[j] = conn
 	}
 
-	time.Sleep(60 * time.Millisecond) // Ensure flush
-	require.Equal(int64(10), c.countSum.Load())
+	clock.Advance(10 * time.Millisecond) // Triggers a flush.
+	require.Eventually(func() bool {
+		return c.countSum.Load() == 10
+	}, time.Second, time.Millisecond)
 	require.Equal(10.0, c.gaugeMax.Load())
 
 	for j := 0; j < 2; j++ {
@@ -137,6 +151,313 @@ func TestListener(t *testing.T) {
 	require.Equal(10.0, c.gaugeMax.Load())
 }
 
+type taggedMockClient struct {
+	t                *testing.T
+	gaugeName        string
+	countName        string
+	gaugeTags        [][]string
+	countTags        [][]string
+	countTagsMutex   *sync.Mutex
+	distributionTags [][]string
+}
+
+func (c *taggedMockClient) Count(name string, value int64, tags []string, rate float64) error {
+	if name != c.countName {
+		c.t.Fatalf("unexpected metric name: %q", name)
+	}
+	c.countTagsMutex.Lock()
+	defer c.countTagsMutex.Unlock()
+	c.countTags = append(c.countTags, tags)
+	return nil
+}
+
+func (c *taggedMockClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	if name != c.gaugeName {
+		c.t.Fatalf("unexpected metric name: %q", name)
+	}
+	c.gaugeTags = append(c.gaugeTags, tags)
+	return nil
+}
+
+func (c *taggedMockClient) Histogram(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *taggedMockClient) Distribution(name string, value float64, tags []string, rate float64) error {
+	c.distributionTags = append(c.distributionTags, tags)
+	return nil
+}
+
+func TestListener_CustomTagsAndMetricNames(t *testing.T) {
+	require := require.New(t)
+
+	c := &taggedMockClient{
+		t:              t,
+		gaugeName:      "custom.gauge",
+		countName:      "custom.count",
+		countTagsMutex: &sync.Mutex{},
+	}
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval:   10 * time.Millisecond,
+		Tags:            []string{"service:api"},
+		GaugeMetricName: c.gaugeName,
+		CountMetricName: c.countName,
+	})
+
+	conn, _ := listener.Accept()
+	conn.Close() // Emits the connection_duration distribution, tagged.
+
+	listener.Close()
+
+	require.Contains(c.gaugeTags[len(c.gaugeTags)-1], "service:api")
+	countTags := c.countTags[len(c.countTags)-1]
+	require.Contains(countTags, "service:api")
+	require.Contains(countTags, ddext.TagStatusSuccess)
+
+	require.NotEmpty(c.distributionTags)
+	require.Contains(c.distributionTags[len(c.distributionTags)-1], "service:api")
+}
+
+type recordingClient struct {
+	mu     sync.Mutex
+	counts []metricCall
+	gauges []metricCall
+}
+
+type metricCall struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+func (c *recordingClient) Count(name string, value int64, tags []string, rate float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = append(c.counts, metricCall{name, float64(value), tags})
+	return nil
+}
+
+func (c *recordingClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gauges = append(c.gauges, metricCall{name, value, tags})
+	return nil
+}
+
+func (c *recordingClient) Histogram(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *recordingClient) Distribution(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func TestListener_MaxOpenConnectionsReject(t *testing.T) {
+	require := require.New(t)
+
+	c := &recordingClient{}
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval:      10 * time.Millisecond,
+		MaxOpenConnections: 1,
+		// OnOverLimit defaults to ddext.Reject.
+	})
+
+	conn, err := listener.Accept()
+	require.NoError(err)
+
+	_, err = listener.Accept()
+	require.ErrorIs(err, ddext.ErrAtCapacity)
+
+	conn.Close()
+
+	_, err = listener.Accept()
+	require.NoError(err)
+
+	listener.Close()
+
+	var rejectedCount float64
+	c.mu.Lock()
+	for _, m := range c.counts {
+		if contains(m.tags, ddext.TagStatusRejected) {
+			rejectedCount += m.value
+		}
+	}
+	c.mu.Unlock()
+	require.Equal(1.0, rejectedCount)
+}
+
+func TestListener_MaxOpenConnectionsClose(t *testing.T) {
+	require := require.New(t)
+
+	c := &recordingClient{}
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval:      10 * time.Millisecond,
+		MaxOpenConnections: 1,
+		OnOverLimit:        ddext.Close,
+	})
+
+	conn, err := listener.Accept()
+	require.NoError(err)
+
+	// Over limit: Accept should accept-and-close the pending connection
+	// (so the client sees a clean disconnect) and report an error.
+	_, err = listener.Accept()
+	require.ErrorIs(err, ddext.ErrAtCapacity)
+
+	conn.Close()
+}
+
+func TestListener_MaxOpenConnectionsBlock(t *testing.T) {
+	require := require.New(t)
+
+	c := &recordingClient{}
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval:      10 * time.Millisecond,
+		MaxOpenConnections: 1,
+		OnOverLimit:        ddext.Block,
+	})
+
+	conn, err := listener.Accept()
+	require.NoError(err)
+
+	// Over limit: Accept should block (polling) rather than return, until
+	// capacity frees up.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := listener.Accept()
+		require.NoError(err)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Accept returned before capacity freed up")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Accept did not unblock once capacity freed up")
+	}
+}
+
+func TestListener_MaxOpenConnectionsBlock_CloseUnblocksAccept(t *testing.T) {
+	require := require.New(t)
+
+	c := &recordingClient{}
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval:      10 * time.Millisecond,
+		MaxOpenConnections: 1,
+		OnOverLimit:        ddext.Block,
+	})
+
+	_, err := listener.Accept()
+	require.NoError(err)
+
+	// Accept is now blocked waiting for capacity; Close must still return
+	// rather than deadlock on the blocked Accept.
+	acceptDone := make(chan struct{})
+	go func() {
+		defer close(acceptDone)
+		listener.Accept()
+	}()
+
+	closeDone := make(chan struct{})
+	go func() {
+		defer close(closeDone)
+		listener.Close()
+	}()
+
+	select {
+	case <-closeDone:
+	case <-time.After(time.Second):
+		t.Fatal("Close deadlocked while Accept was blocked under the Block policy")
+	}
+
+	select {
+	case <-acceptDone:
+	case <-time.After(time.Second):
+		t.Fatal("blocked Accept did not unblock on Close")
+	}
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func TestListener_MockClock_NoFlushBeforeInterval(t *testing.T) {
+	require := require.New(t)
+
+	c := &recordingClient{}
+	clock := ddexttest.NewMockClock(time.Unix(0, 0))
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval: time.Second,
+		Clock:         clock,
+	})
+	defer listener.Close()
+
+	listener.Accept()
+	clock.Advance(500 * time.Millisecond) // Half the flush interval: no tick yet.
+	time.Sleep(10 * time.Millisecond)     // Give listener.run a chance to misbehave.
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Empty(c.counts)
+}
+
+func TestListener_MockClock_ConnectionDuration(t *testing.T) {
+	require := require.New(t)
+
+	c := &distributionRecordingClient{}
+	clock := ddexttest.NewMockClock(time.Unix(0, 0))
+	listener, _ := ddext.NewListener(noopListener{}, c, ddext.ListenerOptions{
+		FlushInterval: time.Second,
+		Clock:         clock,
+	})
+	defer listener.Close()
+
+	conn, _ := listener.Accept()
+	clock.Advance(250 * time.Millisecond)
+	conn.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Len(c.durations, 1)
+	require.Equal(0.25, c.durations[0])
+}
+
+type distributionRecordingClient struct {
+	mu        sync.Mutex
+	durations []float64
+}
+
+func (c *distributionRecordingClient) Count(name string, value int64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *distributionRecordingClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *distributionRecordingClient) Histogram(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *distributionRecordingClient) Distribution(name string, value float64, tags []string, rate float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.durations = append(c.durations, value)
+	return nil
+}
+
 type noopClient struct{}
 
 func (noopClient) Count(name string, value int64, tags []string, rate float64) error {
@@ -147,6 +468,14 @@ func (noopClient) Gauge(name string, value float64, tags []string, rate float64)
 	return nil
 }
 
+func (noopClient) Histogram(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (noopClient) Distribution(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
 func BenchmarkListener_Serial(b *testing.B) {
 	listener, _ := ddext.NewListener(noopListener{}, noopClient{})
 